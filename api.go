@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// REST+JSON API under /api/v1, for scripts and non-browser clients. This is
+// a parallel surface to the form-post handlers registered above: it speaks
+// JSON in and out, uses proper HTTP verbs, and supports ETag/If-Match for
+// optimistic concurrency. The HTML UI keeps using the form endpoints.
+
+// apiTodoWrite is the JSON body accepted by POST and PATCH /api/v1/todos.
+// Deadline uses the same YYYY-MM-DD format as the rest of the app rather
+// than RFC 3339, so it round-trips through stringToDeadline like every
+// other entry point.
+type apiTodoWrite struct {
+	Summary  *string `json:"summary"`
+	Details  *string `json:"details"`
+	Priority *int8   `json:"priority"`
+	Deadline *string `json:"deadline"`
+	RRule    *string `json:"rrule"`
+	Done     *bool   `json:"done"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// etagFor derives an ETag from an md5 of the todo's marshalled JSON, so any
+// field change (including a sync-driven one) invalidates a client's cached
+// copy.
+func etagFor(t Todo) string {
+	data, _ := json.Marshal(t)
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// registerAPIRoutes wires the /api/v1/todos surface onto the default mux.
+func registerAPIRoutes(store Store) {
+	http.HandleFunc("/api/v1/todos", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			apiListTodos(w, r, store)
+		case http.MethodPost:
+			apiCreateTodo(w, r, store)
+		default:
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+
+	http.HandleFunc("/api/v1/todos/", func(w http.ResponseWriter, r *http.Request) {
+		raw := strings.TrimPrefix(r.URL.Path, "/api/v1/todos/")
+		summary, err := url.PathUnescape(raw)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid summary")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			apiGetTodo(w, store, summary)
+		case http.MethodPatch:
+			apiPatchTodo(w, r, store, summary)
+		case http.MethodDelete:
+			apiDeleteTodo(w, r, store, summary)
+		default:
+			writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+}
+
+func apiListTodos(w http.ResponseWriter, r *http.Request, store Store) {
+	todos, err := store.List()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	q := r.URL.Query()
+	if doneStr := q.Get("done"); doneStr != "" {
+		want, err := strconv.ParseBool(doneStr)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid done filter")
+			return
+		}
+		todos = filterTodos(todos, func(t Todo) bool { return t.Done == want })
+	}
+	if priorityStr := q.Get("priority"); priorityStr != "" {
+		p, err := strconv.ParseInt(priorityStr, 10, 8)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid priority filter")
+			return
+		}
+		todos = filterTodos(todos, func(t Todo) bool { return int64(t.Priority) == p })
+	}
+	if query := q.Get("q"); query != "" {
+		needle := strings.ToLower(query)
+		todos = filterTodos(todos, func(t Todo) bool {
+			return strings.Contains(strings.ToLower(t.Summary), needle) || strings.Contains(strings.ToLower(t.Details), needle)
+		})
+	}
+
+	writeJSON(w, http.StatusOK, sortTodos(todos))
+}
+
+func filterTodos(todos []Todo, keep func(Todo) bool) []Todo {
+	out := todos[:0:0]
+	for _, t := range todos {
+		if keep(t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func apiCreateTodo(w http.ResponseWriter, r *http.Request, store Store) {
+	var body apiTodoWrite
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if body.Summary == nil {
+		writeJSONError(w, http.StatusBadRequest, "summary is required")
+		return
+	}
+
+	var deadlineStr, priorityStr, rruleStr, details string
+	if body.Deadline != nil {
+		deadlineStr = *body.Deadline
+	}
+	if body.Priority != nil {
+		priorityStr = strconv.FormatInt(int64(*body.Priority), 10)
+	}
+	if body.RRule != nil {
+		rruleStr = *body.RRule
+	}
+	if body.Details != nil {
+		details = *body.Details
+	}
+
+	if _, err := addTodoOperation(store, *body.Summary, details, deadlineStr, priorityStr, rruleStr); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, ok, err := store.Get(*body.Summary)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "todo added but not found")
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(created))
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func apiGetTodo(w http.ResponseWriter, store Store, summary string) {
+	t, ok, err := store.Get(summary)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "todo not found")
+		return
+	}
+	w.Header().Set("ETag", etagFor(t))
+	writeJSON(w, http.StatusOK, t)
+}
+
+func apiPatchTodo(w http.ResponseWriter, r *http.Request, store Store, summary string) {
+	_, ok, err := store.Get(summary)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "todo not found")
+		return
+	}
+
+	var body apiTodoWrite
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	patch := TodoPatch{
+		Done:     body.Done,
+		Summary:  body.Summary,
+		Details:  body.Details,
+		Priority: body.Priority,
+		RRule:    body.RRule,
+	}
+	if body.Deadline != nil {
+		dl, err := stringToDeadline(*body.Deadline)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		patch.Deadline = dl
+	}
+
+	if _, err := setTodoOperation(store, summary, patch, r.Header.Get("If-Match")); err != nil {
+		if errors.Is(err, errETagMismatch) {
+			writeJSONError(w, http.StatusPreconditionFailed, "etag mismatch")
+			return
+		}
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	newSummary := summary
+	if patch.Summary != nil {
+		newSummary = *patch.Summary
+	}
+	updated, ok, err := store.Get(newSummary)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "todo updated but not found")
+		return
+	}
+
+	w.Header().Set("ETag", etagFor(updated))
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func apiDeleteTodo(w http.ResponseWriter, r *http.Request, store Store, summary string) {
+	_, ok, err := store.Get(summary)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "todo not found")
+		return
+	}
+
+	if _, err := deleteTodoOperation(store, summary, r.Header.Get("If-Match")); err != nil {
+		if errors.Is(err, errETagMismatch) {
+			writeJSONError(w, http.StatusPreconditionFailed, "etag mismatch")
+			return
+		}
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
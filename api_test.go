@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func newTestJSONStore(t *testing.T) *jsonStore {
+	t.Helper()
+	f, err := os.CreateTemp("", "gotodo-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	f.Close()
+	return newJSONStore(f.Name())
+}
+
+func TestAPICreateAndGetTodo(t *testing.T) {
+	store := newTestJSONStore(t)
+
+	body, _ := json.Marshal(apiTodoWrite{Summary: strPtr2("buy milk")})
+	req := httptest.NewRequest("POST", "/api/v1/todos", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	apiCreateTodo(w, req, store)
+
+	if w.Code != 201 {
+		t.Fatalf("POST status = %d, want 201", w.Code)
+	}
+	if w.Header().Get("ETag") == "" {
+		t.Fatal("POST response missing ETag header")
+	}
+
+	w = httptest.NewRecorder()
+	apiGetTodo(w, store, "buy milk")
+	if w.Code != 200 {
+		t.Fatalf("GET status = %d, want 200", w.Code)
+	}
+}
+
+func TestAPIGetMissingTodoReturns404(t *testing.T) {
+	store := newTestJSONStore(t)
+	w := httptest.NewRecorder()
+	apiGetTodo(w, store, "nope")
+	if w.Code != 404 {
+		t.Fatalf("GET status = %d, want 404", w.Code)
+	}
+}
+
+func TestAPIPatchWithCurrentIfMatchSucceeds(t *testing.T) {
+	store := newTestJSONStore(t)
+	added, err := store.Add(Todo{Summary: "buy milk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := etagFor(added)
+
+	body, _ := json.Marshal(apiTodoWrite{Details: strPtr2("2% please")})
+	req := httptest.NewRequest("PATCH", "/api/v1/todos/buy%20milk", bytes.NewReader(body))
+	req.Header.Set("If-Match", etag)
+	w := httptest.NewRecorder()
+	apiPatchTodo(w, req, store, "buy milk")
+
+	if w.Code != 200 {
+		t.Fatalf("PATCH status = %d, want 200, body=%s", w.Code, w.Body.String())
+	}
+}
+
+func TestAPIPatchWithStaleIfMatchReturns412(t *testing.T) {
+	store := newTestJSONStore(t)
+	added, err := store.Add(Todo{Summary: "buy milk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := etagFor(added)
+
+	// Change the todo so its ETag moves on, making `stale` out of date.
+	first := "2% please"
+	if _, err := store.Update("buy milk", TodoPatch{Details: &first}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(apiTodoWrite{Details: strPtr2("whole milk")})
+	req := httptest.NewRequest("PATCH", "/api/v1/todos/buy%20milk", bytes.NewReader(body))
+	req.Header.Set("If-Match", stale)
+	w := httptest.NewRecorder()
+	apiPatchTodo(w, req, store, "buy milk")
+
+	if w.Code != 412 {
+		t.Fatalf("PATCH status = %d, want 412, body=%s", w.Code, w.Body.String())
+	}
+
+	got, _, err := store.Get("buy milk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Details != first {
+		t.Errorf("Details = %q, want %q (stale PATCH must not have applied)", got.Details, first)
+	}
+}
+
+func TestAPIDeleteWithStaleIfMatchReturns412(t *testing.T) {
+	store := newTestJSONStore(t)
+	added, err := store.Add(Todo{Summary: "buy milk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := etagFor(added)
+
+	details := "2% please"
+	if _, err := store.Update("buy milk", TodoPatch{Details: &details}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("DELETE", "/api/v1/todos/buy%20milk", nil)
+	req.Header.Set("If-Match", stale)
+	w := httptest.NewRecorder()
+	apiDeleteTodo(w, req, store, "buy milk")
+
+	if w.Code != 412 {
+		t.Fatalf("DELETE status = %d, want 412, body=%s", w.Code, w.Body.String())
+	}
+	if _, ok, err := store.Get("buy milk"); err != nil || !ok {
+		t.Fatalf("todo should survive a rejected delete: ok=%v, err=%v", ok, err)
+	}
+}
+
+func TestAPIDeleteWithCurrentIfMatchSucceeds(t *testing.T) {
+	store := newTestJSONStore(t)
+	added, err := store.Add(Todo{Summary: "buy milk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := etagFor(added)
+
+	req := httptest.NewRequest("DELETE", "/api/v1/todos/buy%20milk", nil)
+	req.Header.Set("If-Match", etag)
+	w := httptest.NewRecorder()
+	apiDeleteTodo(w, req, store, "buy milk")
+
+	if w.Code != 204 {
+		t.Fatalf("DELETE status = %d, want 204, body=%s", w.Code, w.Body.String())
+	}
+	if _, ok, err := store.Get("buy milk"); err != nil || ok {
+		t.Fatalf("todo should be gone: ok=%v, err=%v", ok, err)
+	}
+}
+
+func TestAPIDeleteWithoutIfMatchSkipsCheck(t *testing.T) {
+	store := newTestJSONStore(t)
+	if _, err := store.Add(Todo{Summary: "buy milk"}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("DELETE", "/api/v1/todos/buy%20milk", nil)
+	w := httptest.NewRecorder()
+	apiDeleteTodo(w, req, store, "buy milk")
+
+	if w.Code != 204 {
+		t.Fatalf("DELETE status = %d, want 204, body=%s", w.Code, w.Body.String())
+	}
+}
+
+func strPtr2(s string) *string { return &s }
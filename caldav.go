@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// CalDAV sync: maps Todo <-> VTODO and reconciles ~/.gotodo.json against a
+// remote calendar collection (Nextcloud, Radicale, etc.).
+
+// CalDAVConfig holds credentials for a remote calendar. It is kept separate
+// from ~/.gotodo.json so the todo file itself never carries secrets.
+type CalDAVConfig struct {
+	URL      string `json:"url"`
+	User     string `json:"user"`
+	Pass     string `json:"pass"`
+	Calendar string `json:"calendar"`
+}
+
+var caldavConfigFile = fmt.Sprintf("%s/.gotodo-caldav.json", homePath)
+
+func loadCalDAVConfig() (CalDAVConfig, error) {
+	f, err := os.Open(caldavConfigFile)
+	if err != nil {
+		return CalDAVConfig{}, err
+	}
+	defer f.Close()
+
+	var cfg CalDAVConfig
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return CalDAVConfig{}, fmt.Errorf("parse %s: %w", caldavConfigFile, err)
+	}
+	return cfg, nil
+}
+
+// calDAVClient speaks just enough CalDAV to list, fetch, upload and delete
+// VTODO resources within a single calendar collection.
+type calDAVClient struct {
+	cfg CalDAVConfig
+	hc  *http.Client
+}
+
+func newCalDAVClient(cfg CalDAVConfig) *calDAVClient {
+	return &calDAVClient{cfg: cfg, hc: &http.Client{Timeout: 30 * time.Second}}
+}
+
+func (c *calDAVClient) collectionURL() string {
+	base := strings.TrimSuffix(c.cfg.URL, "/")
+	return base + "/" + strings.Trim(c.cfg.Calendar, "/") + "/"
+}
+
+func (c *calDAVClient) resourceURL(uid string) string {
+	return c.collectionURL() + uid + ".ics"
+}
+
+func (c *calDAVClient) do(method, target string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.cfg.User, c.cfg.Pass)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return c.hc.Do(req)
+}
+
+// remoteVTODO is a remote resource discovered via calendar-query REPORT.
+type remoteVTODO struct {
+	UID  string
+	ETag string
+	Todo Todo
+}
+
+const calendarQueryBody = `<?xml version="1.0" encoding="utf-8" ?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <D:getetag/>
+    <C:calendar-data/>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VTODO"/>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`
+
+// list performs PROPFIND (to confirm the collection exists) followed by a
+// calendar-query REPORT that returns every VTODO in the collection.
+func (c *calDAVClient) list() (map[string]remoteVTODO, error) {
+	propfind, err := c.do("PROPFIND", c.collectionURL(), strings.NewReader(`<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/></D:prop></D:propfind>`),
+		map[string]string{"Depth": "1", "Content-Type": "application/xml"})
+	if err != nil {
+		return nil, fmt.Errorf("propfind: %w", err)
+	}
+	propfind.Body.Close()
+	if propfind.StatusCode != 207 && propfind.StatusCode != 200 {
+		return nil, fmt.Errorf("propfind %s: unexpected status %d", c.collectionURL(), propfind.StatusCode)
+	}
+
+	resp, err := c.do("REPORT", c.collectionURL(), strings.NewReader(calendarQueryBody),
+		map[string]string{"Depth": "1", "Content-Type": "application/xml"})
+	if err != nil {
+		return nil, fmt.Errorf("calendar-query: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 207 {
+		return nil, fmt.Errorf("calendar-query: unexpected status %d", resp.StatusCode)
+	}
+
+	return parseCalendarQueryResponse(body)
+}
+
+// parseCalendarQueryResponse extracts <D:getetag> and <C:calendar-data>
+// pairs from a multistatus REPORT response without pulling in a full XML
+// object model, matching the rest of the package's preference for small,
+// purpose-built parsing over general frameworks.
+func parseCalendarQueryResponse(body []byte) (map[string]remoteVTODO, error) {
+	out := map[string]remoteVTODO{}
+	s := string(body)
+	for _, resp := range splitTag(s, "response") {
+		etag := strings.TrimSpace(firstTag(resp, "getetag"))
+		data := firstTag(resp, "calendar-data")
+		data = strings.ReplaceAll(data, "&lt;", "<")
+		data = strings.ReplaceAll(data, "&gt;", ">")
+		data = strings.ReplaceAll(data, "&amp;", "&")
+		for _, vtodo := range splitVTODOs(data) {
+			t, err := vtodoToTodo(vtodo)
+			if err != nil {
+				continue
+			}
+			out[t.UID] = remoteVTODO{UID: t.UID, ETag: etag, Todo: t}
+		}
+	}
+	return out, nil
+}
+
+// splitTag returns the inner content of every occurrence of a <tag ...>...</tag>
+// element (namespace prefix agnostic, e.g. matches both <C:calendar-data> and
+// <calendar-data>) within s. The closing tag is matched by name rather than
+// by taking the next "</" wholesale, so a tag whose content itself contains
+// other elements (e.g. <D:response> wrapping <D:propstat>/<D:prop>) doesn't
+// get truncated at its first child's closing tag.
+func splitTag(s, tag string) []string {
+	var out []string
+	lower := strings.ToLower(s)
+	needle := strings.ToLower(tag)
+	i := 0
+	for {
+		idx := strings.Index(lower[i:], needle)
+		if idx == -1 {
+			break
+		}
+		idx += i
+
+		openEnd := strings.Index(s[idx:], ">")
+		if openEnd == -1 {
+			break
+		}
+		contentStart := idx + openEnd + 1
+
+		closeStart, closeTagEnd, ok := findClosingTag(lower, needle, contentStart)
+		if !ok {
+			break
+		}
+
+		out = append(out, s[contentStart:closeStart])
+		i = closeTagEnd + 1
+	}
+	return out
+}
+
+// findClosingTag scans forward from start for a "</...>" tag whose name
+// matches needle (ignoring any namespace prefix), skipping over closing
+// tags that belong to other, nested elements.
+func findClosingTag(lower, needle string, start int) (closeStart, tagEnd int, ok bool) {
+	for pos := start; ; {
+		i := strings.Index(lower[pos:], "</")
+		if i == -1 {
+			return 0, 0, false
+		}
+		i += pos
+
+		end := strings.Index(lower[i:], ">")
+		if end == -1 {
+			return 0, 0, false
+		}
+		end += i
+
+		name := strings.TrimSpace(lower[i+2 : end])
+		if name == needle || strings.HasSuffix(name, ":"+needle) {
+			return i, end, true
+		}
+		pos = end + 1
+	}
+}
+
+func firstTag(s, tag string) string {
+	parts := splitTag(s, tag)
+	if len(parts) == 0 {
+		return ""
+	}
+	return parts[0]
+}
+
+// put uploads a single VTODO wrapped in a minimal VCALENDAR, using If-Match
+// for optimistic concurrency when etag is non-empty.
+func (c *calDAVClient) put(t Todo, etag string) (newETag string, err error) {
+	var ics bytes.Buffer
+	ics.WriteString("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//gotodo//EN\r\n")
+	ics.WriteString(todoToVTODO(t))
+	ics.WriteString("END:VCALENDAR\r\n")
+
+	headers := map[string]string{"Content-Type": "text/calendar; charset=utf-8"}
+	if etag != "" {
+		headers["If-Match"] = etag
+	}
+	resp, err := c.do("PUT", c.resourceURL(t.UID), &ics, headers)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return "", errConflict
+	}
+	if resp.StatusCode != 201 && resp.StatusCode != 204 {
+		return "", fmt.Errorf("put %s: unexpected status %d", t.UID, resp.StatusCode)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+func (c *calDAVClient) delete(uid, etag string) error {
+	headers := map[string]string{}
+	if etag != "" {
+		headers["If-Match"] = etag
+	}
+	resp, err := c.do("DELETE", c.resourceURL(uid), nil, headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return errConflict
+	}
+	if resp.StatusCode != 200 && resp.StatusCode != 204 && resp.StatusCode != 404 {
+		return fmt.Errorf("delete %s: unexpected status %d", uid, resp.StatusCode)
+	}
+	return nil
+}
+
+var errConflict = errors.New("remote resource changed since last sync (etag mismatch)")
+
+// caldavSync reconciles the store against the remote calendar collection
+// described by cfg. When localWins is true, a conflicting item keeps the
+// local version and re-uploads it; otherwise the remote version wins and is
+// written back locally. New local items are pushed, new remote items are
+// pulled in, and items missing on one side that have a LastSync are treated
+// as deletions and propagated. The reconciled list is written back with a
+// single ReplaceAll so a failure partway through a sync can't leave the
+// store straddling two inconsistent views.
+func caldavSync(store bulkStore, cfg CalDAVConfig, localWins bool) (string, error) {
+	client := newCalDAVClient(cfg)
+	remote, err := client.list()
+	if err != nil {
+		return "", err
+	}
+
+	todos, err := store.List()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	byUID := make(map[string]int, len(todos))
+	for i, t := range todos {
+		byUID[t.UID] = i
+	}
+
+	pushed, pulled, conflicts := 0, 0, 0
+	seen := map[string]bool{}
+	var deleted []string
+
+	for uid, idx := range byUID {
+		local := todos[idx]
+		r, onRemote := remote[uid]
+		seen[uid] = true
+
+		switch {
+		case !onRemote && !local.LastSync.IsZero():
+			// previously synced, now gone remotely: remote deleted it.
+			deleted = append(deleted, uid)
+		case !onRemote:
+			etag, err := client.put(local, "")
+			if err != nil {
+				return "", fmt.Errorf("push %s: %w", local.Summary, err)
+			}
+			local.ETag, local.LastSync = etag, now
+			todos[idx] = local
+			pushed++
+		case local.ETag == r.ETag:
+			// unchanged since last sync, nothing to do.
+		default:
+			if localWins {
+				etag, err := client.put(local, r.ETag)
+				if err != nil {
+					if errors.Is(err, errConflict) {
+						conflicts++
+						continue
+					}
+					return "", fmt.Errorf("push %s: %w", local.Summary, err)
+				}
+				local.ETag, local.LastSync = etag, now
+			} else {
+				r.Todo.ETag, r.Todo.LastSync = r.ETag, now
+				r.Todo.RRuleRemaining = local.RRuleRemaining
+				local = r.Todo
+				pulled++
+			}
+			todos[idx] = local
+		}
+	}
+
+	if len(deleted) > 0 {
+		todos = removeUIDs(todos, deleted)
+	}
+
+	for uid, r := range remote {
+		if seen[uid] {
+			continue
+		}
+		t := r.Todo
+		t.ETag, t.LastSync = r.ETag, now
+		todos = append(todos, t)
+		pulled++
+	}
+
+	if err := store.ReplaceAll(todos); err != nil {
+		return "", err
+	}
+	if pushed+pulled+len(deleted) > 0 {
+		hub.Publish(Event{Type: "synced"})
+	}
+	return fmt.Sprintf("caldav sync: %d pushed, %d pulled, %d conflicts", pushed, pulled, conflicts), nil
+}
+
+func removeUIDs(todos []Todo, uids []string) []Todo {
+	drop := make(map[string]bool, len(uids))
+	for _, u := range uids {
+		drop[u] = true
+	}
+	out := todos[:0:0]
+	for _, t := range todos {
+		if !drop[t.UID] {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// caldavSyncHTTP exposes caldavSync as the /api/caldav/sync handler.
+func caldavSyncHTTP(store bulkStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad form", http.StatusBadRequest)
+			return
+		}
+
+		cfg := CalDAVConfig{
+			URL:      r.Form.Get("url"),
+			User:     r.Form.Get("user"),
+			Pass:     r.Form.Get("pass"),
+			Calendar: r.Form.Get("calendar"),
+		}
+		if cfg.URL == "" {
+			if fileCfg, err := loadCalDAVConfig(); err == nil {
+				cfg = fileCfg
+			}
+		}
+		if cfg.URL == "" {
+			http.Error(w, "caldav not configured", http.StatusBadRequest)
+			return
+		}
+
+		message, err := caldavSync(store, cfg, isTrue(r.Form.Get("local_wins")))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintln(w, message)
+	}
+}
+
+// parseURLOrEmpty is a tiny guard used by the CLI to give a clearer error
+// than net/http would for a malformed --url.
+func parseURLOrEmpty(s string) error {
+	if s == "" {
+		return nil
+	}
+	_, err := url.Parse(s)
+	return err
+}
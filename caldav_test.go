@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockCalDAVServer is a minimal in-memory CalDAV collection: it answers
+// PROPFIND, the calendar-query REPORT used by calDAVClient.list, and PUT/
+// DELETE on individual resources, tracking one ETag per UID so If-Match
+// preconditions behave like a real server.
+type mockCalDAVServer struct {
+	mu    sync.Mutex
+	items map[string]mockItem // uid -> item
+	seq   int
+}
+
+type mockItem struct {
+	etag string
+	ics  string
+}
+
+func newMockCalDAVServer() *httptest.Server {
+	m := &mockCalDAVServer{items: map[string]mockItem{}}
+	return httptest.NewServer(http.HandlerFunc(m.handle))
+}
+
+func (m *mockCalDAVServer) nextETag() string {
+	m.seq++
+	return fmt.Sprintf(`"etag-%d"`, m.seq)
+}
+
+func (m *mockCalDAVServer) handle(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch r.Method {
+	case "PROPFIND":
+		w.WriteHeader(207)
+	case "REPORT":
+		var b strings.Builder
+		b.WriteString(`<?xml version="1.0"?><D:multistatus xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">`)
+		for _, it := range m.items {
+			data := strings.ReplaceAll(it.ics, "&", "&amp;")
+			data = strings.ReplaceAll(data, "<", "&lt;")
+			data = strings.ReplaceAll(data, ">", "&gt;")
+			fmt.Fprintf(&b, `<D:response><D:propstat><D:prop><D:getetag>%s</D:getetag><C:calendar-data>%s</C:calendar-data></D:prop></D:propstat></D:response>`, it.etag, data)
+		}
+		b.WriteString(`</D:multistatus>`)
+		w.WriteHeader(207)
+		io.WriteString(w, b.String())
+	case "PUT":
+		uid := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/cal/"), ".ics")
+		body, _ := io.ReadAll(r.Body)
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+			if existing, ok := m.items[uid]; !ok || existing.etag != ifMatch {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+		}
+		etag := m.nextETag()
+		m.items[uid] = mockItem{etag: etag, ics: string(body)}
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(201)
+	case "DELETE":
+		uid := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/cal/"), ".ics")
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+			if existing, ok := m.items[uid]; !ok || existing.etag != ifMatch {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+		}
+		delete(m.items, uid)
+		w.WriteHeader(204)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func testCalDAVConfig(serverURL string) CalDAVConfig {
+	return CalDAVConfig{URL: serverURL, Calendar: "cal"}
+}
+
+func TestCalDAVSyncPushesNewLocalTodo(t *testing.T) {
+	srv := newMockCalDAVServer()
+	defer srv.Close()
+
+	store := newTestJSONStore(t)
+	if _, err := store.Add(Todo{Summary: "buy milk", UID: "uid-1", Priority: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := caldavSync(store, testCalDAVConfig(srv.URL), false)
+	if err != nil {
+		t.Fatalf("caldavSync: %v", err)
+	}
+	if !strings.Contains(msg, "1 pushed") {
+		t.Errorf("message = %q, want it to mention 1 pushed", msg)
+	}
+
+	todos, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 1 || todos[0].ETag == "" || todos[0].LastSync.IsZero() {
+		t.Fatalf("local todo not marked synced: %+v", todos)
+	}
+}
+
+func TestCalDAVSyncPullsNewRemoteTodo(t *testing.T) {
+	srv := newMockCalDAVServer()
+	defer srv.Close()
+
+	store := newTestJSONStore(t)
+
+	// Seed the remote collection directly via a PUT, simulating an item
+	// that was created on another client.
+	remote := Todo{UID: "uid-remote", Summary: "water plants", Priority: 2}
+	ics := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" + todoToVTODO(remote) + "END:VCALENDAR\r\n"
+	req, err := http.NewRequest("PUT", srv.URL+"/cal/uid-remote.ics", strings.NewReader(ics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	msg, err := caldavSync(store, testCalDAVConfig(srv.URL), false)
+	if err != nil {
+		t.Fatalf("caldavSync: %v", err)
+	}
+	if !strings.Contains(msg, "1 pulled") {
+		t.Errorf("message = %q, want it to mention 1 pulled", msg)
+	}
+
+	todos, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 1 || todos[0].Summary != "water plants" {
+		t.Fatalf("remote todo not pulled in: %+v", todos)
+	}
+}
+
+func TestCalDAVSyncRemoteWinsPreservesRRuleRemaining(t *testing.T) {
+	srv := newMockCalDAVServer()
+	defer srv.Close()
+
+	store := newTestJSONStore(t)
+	local := Todo{
+		UID:            "uid-1",
+		Summary:        "water plants",
+		RRule:          "FREQ=DAILY",
+		RRuleRemaining: 3,
+		ETag:           `"old-etag"`,
+		LastSync:       time.Now().Add(-time.Hour),
+	}
+	if _, err := store.Add(local); err != nil {
+		t.Fatal(err)
+	}
+
+	// Seed the remote with a different ETag for the same UID, so the sync
+	// sees a conflict and (with localWins=false) pulls the remote version.
+	req, _ := http.NewRequest("PUT", srv.URL+"/cal/uid-1.ics", strings.NewReader("BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"+todoToVTODO(Todo{UID: "uid-1", Summary: "water plants", RRule: "FREQ=DAILY"})+"END:VCALENDAR\r\n"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if _, err := caldavSync(store, testCalDAVConfig(srv.URL), false); err != nil {
+		t.Fatalf("caldavSync: %v", err)
+	}
+
+	todos, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 1 {
+		t.Fatalf("len(todos) = %d, want 1", len(todos))
+	}
+	if todos[0].RRuleRemaining != 3 {
+		t.Errorf("RRuleRemaining = %d, want 3 (must survive a remote-wins merge)", todos[0].RRuleRemaining)
+	}
+}
+
+func TestSplitTagSkipsNestedChildClosingTags(t *testing.T) {
+	xml := `<D:response><D:propstat><D:prop><D:getetag>"etag-1"</D:getetag><C:calendar-data>DATA</C:calendar-data></D:prop></D:propstat></D:response>`
+
+	responses := splitTag(xml, "response")
+	if len(responses) != 1 {
+		t.Fatalf("len(responses) = %d, want 1", len(responses))
+	}
+
+	etag := firstTag(responses[0], "getetag")
+	if etag != `"etag-1"` {
+		t.Errorf("etag = %q, want %q", etag, `"etag-1"`)
+	}
+	data := firstTag(responses[0], "calendar-data")
+	if data != "DATA" {
+		t.Errorf("calendar-data = %q, want %q", data, "DATA")
+	}
+}
+
+func TestCalDAVSyncRemovesLocalTodoDeletedRemotely(t *testing.T) {
+	srv := newMockCalDAVServer()
+	defer srv.Close()
+
+	store := newTestJSONStore(t)
+	local := Todo{
+		UID:      "uid-1",
+		Summary:  "buy milk",
+		ETag:     `"etag-1"`,
+		LastSync: time.Now().Add(-time.Hour),
+	}
+	if _, err := store.Add(local); err != nil {
+		t.Fatal(err)
+	}
+
+	// Remote has nothing for uid-1 (never PUT), so the previously-synced
+	// local todo should be treated as remotely deleted.
+	msg, err := caldavSync(store, testCalDAVConfig(srv.URL), false)
+	if err != nil {
+		t.Fatalf("caldavSync: %v", err)
+	}
+	_ = msg
+
+	todos, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 0 {
+		t.Fatalf("len(todos) = %d, want 0 (remote deletion must propagate)", len(todos))
+	}
+}
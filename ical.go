@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// iCal VTODO encode/decode shared by the CalDAV sync subsystem and the
+// one-shot file-based export/import below.
+
+// icalPriority maps gotodo's 1 (low) - 5 (high) scale onto iCalendar's
+// 1 (high) - 9 (low) scale.
+func icalPriority(p int8) int {
+	switch {
+	case p <= 1:
+		return 9
+	case p >= 5:
+		return 1
+	default:
+		return int(9 - (p-1)*2)
+	}
+}
+
+func fromICalPriority(p int) int8 {
+	switch {
+	case p <= 0:
+		return 1
+	case p >= 9:
+		return 1
+	case p <= 2:
+		return 5
+	case p <= 4:
+		return 4
+	case p <= 6:
+		return 3
+	case p <= 8:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// todoToVTODO renders a Todo as an RFC 5545 VTODO component, with lines
+// folded at 75 octets per section 3.1.
+func todoToVTODO(t Todo) string {
+	var lines []string
+	lines = append(lines, "BEGIN:VTODO")
+	lines = append(lines, fmt.Sprintf("UID:%s", t.UID))
+	lines = append(lines, fmt.Sprintf("SUMMARY:%s", icalEscape(t.Summary)))
+	if t.Details != "" {
+		lines = append(lines, fmt.Sprintf("DESCRIPTION:%s", icalEscape(t.Details)))
+	}
+	if !t.Deadline.IsZero() {
+		lines = append(lines, fmt.Sprintf("DUE;VALUE=DATE:%s", t.Deadline.Format("20060102")))
+	}
+	lines = append(lines, fmt.Sprintf("PRIORITY:%d", icalPriority(t.Priority)))
+	if t.RRule != "" {
+		lines = append(lines, fmt.Sprintf("RRULE:%s", t.RRule))
+	}
+	lines = append(lines, fmt.Sprintf("CREATED:%s", t.AddedAt.UTC().Format("20060102T150405Z")))
+	if t.Done {
+		lines = append(lines, "STATUS:COMPLETED")
+		if !t.DoneAt.IsZero() {
+			lines = append(lines, fmt.Sprintf("COMPLETED:%s", t.DoneAt.UTC().Format("20060102T150405Z")))
+		}
+	} else {
+		lines = append(lines, "STATUS:NEEDS-ACTION")
+	}
+	lines = append(lines, "END:VTODO")
+
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(foldLine(l))
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// foldLine wraps a content line at 75 octets as required by RFC 5545 3.1:
+// continuation lines start with a single space. The cut point is walked
+// back to the nearest rune boundary so a multi-byte UTF-8 character is
+// never split across the fold.
+func foldLine(s string) string {
+	const limit = 75
+	if len(s) <= limit {
+		return s
+	}
+	var b strings.Builder
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+func icalEscape(s string) string {
+	r := strings.NewReplacer("\\", "\\\\", ";", "\\;", ",", "\\,", "\n", "\\n")
+	return r.Replace(s)
+}
+
+func icalUnescape(s string) string {
+	r := strings.NewReplacer("\\n", "\n", "\\,", ",", "\\;", ";", "\\\\", "\\")
+	return r.Replace(s)
+}
+
+// vtodoToTodo parses a single VTODO component (BEGIN:VTODO..END:VTODO,
+// possibly folded) into a Todo. Fields absent from the component are left
+// at their zero value.
+func vtodoToTodo(ics string) (Todo, error) {
+	var t Todo
+	for _, line := range unfoldLines(ics) {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name = strings.SplitN(name, ";", 2)[0]
+		switch name {
+		case "UID":
+			t.UID = value
+		case "SUMMARY":
+			t.Summary = icalUnescape(value)
+		case "DESCRIPTION":
+			t.Details = icalUnescape(value)
+		case "DUE":
+			if d, err := parseICalTime(value); err == nil {
+				t.Deadline = d
+			}
+		case "CREATED":
+			if d, err := parseICalTime(value); err == nil {
+				t.AddedAt = d
+			}
+		case "COMPLETED":
+			if d, err := parseICalTime(value); err == nil {
+				t.DoneAt = d
+			}
+		case "PRIORITY":
+			if p, err := strconv.Atoi(value); err == nil {
+				t.Priority = fromICalPriority(p)
+			}
+		case "STATUS":
+			t.Done = value == "COMPLETED"
+		case "RRULE":
+			if _, err := ParseRRule(value); err == nil {
+				t.RRule = value
+			}
+		}
+	}
+	if t.UID == "" {
+		return Todo{}, errors.New("vtodo missing UID")
+	}
+	return t, nil
+}
+
+func parseICalTime(s string) (time.Time, error) {
+	if d, err := time.Parse("20060102T150405Z", s); err == nil {
+		return d, nil
+	}
+	return time.Parse("20060102", s)
+}
+
+// unfoldLines reverses RFC 5545 line folding (continuation lines start with
+// a space or tab) and returns one logical line per content line.
+func unfoldLines(ics string) []string {
+	raw := strings.Split(strings.ReplaceAll(ics, "\r\n", "\n"), "\n")
+	var lines []string
+	for _, l := range raw {
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// splitVTODOs extracts the raw text of each VTODO component (including its
+// BEGIN:VTODO/END:VTODO delimiters) from an ICS document or fragment.
+func splitVTODOs(ics string) []string {
+	var out []string
+	var cur []string
+	inside := false
+	for _, l := range unfoldLines(ics) {
+		switch trimmed := strings.TrimSpace(l); {
+		case strings.EqualFold(trimmed, "BEGIN:VTODO"):
+			inside = true
+			cur = []string{l}
+		case strings.EqualFold(trimmed, "END:VTODO"):
+			if inside {
+				cur = append(cur, l)
+				out = append(out, strings.Join(cur, "\r\n"))
+			}
+			inside = false
+		case inside:
+			cur = append(cur, l)
+		}
+	}
+	return out
+}
+
+// RenderCalendar serializes todos as a complete RFC 5545 VCALENDAR document
+// with CRLF line endings, suitable for writing to an .ics file or serving
+// as a text/calendar response.
+func RenderCalendar(todos []Todo) string {
+	var b strings.Builder
+	b.WriteString("BEGIN:VCALENDAR\r\n")
+	b.WriteString("PRODID:-//gotodo//EN\r\n")
+	b.WriteString("VERSION:2.0\r\n")
+	for _, t := range todos {
+		b.WriteString(todoToVTODO(t))
+	}
+	b.WriteString("END:VCALENDAR\r\n")
+	return b.String()
+}
+
+// ParseCalendar extracts every VTODO component from an RFC 5545 VCALENDAR
+// document into Todos. Components without a UID are skipped.
+func ParseCalendar(data []byte) []Todo {
+	var out []Todo
+	for _, vtodo := range splitVTODOs(string(data)) {
+		if t, err := vtodoToTodo(vtodo); err == nil {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// mergeImportedTodos applies imported todos onto existing ones, updating by
+// UID when a match exists and inserting otherwise, so re-importing the same
+// feed is idempotent.
+func mergeImportedTodos(existing, imported []Todo) (merged []Todo, created, updated int) {
+	byUID := make(map[string]int, len(existing))
+	for i, t := range existing {
+		byUID[t.UID] = i
+	}
+
+	merged = existing
+	for _, t := range imported {
+		if t.UID == "" {
+			t.UID = newUID()
+		}
+		if i, ok := byUID[t.UID]; ok {
+			merged[i] = t
+			updated++
+			continue
+		}
+		byUID[t.UID] = len(merged)
+		merged = append(merged, t)
+		created++
+	}
+	return merged, created, updated
+}
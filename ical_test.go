@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestVTODORoundTrip(t *testing.T) {
+	in := Todo{
+		UID:      "test-uid-1",
+		Summary:  "pay rent",
+		Details:  "due on the 1st; don't forget",
+		Priority: 4,
+		Deadline: time.Date(2026, time.August, 1, 0, 0, 0, 0, time.UTC),
+		AddedAt:  time.Date(2026, time.July, 1, 9, 0, 0, 0, time.UTC),
+		RRule:    "FREQ=MONTHLY;BYMONTHDAY=1",
+	}
+
+	out, err := vtodoToTodo(todoToVTODO(in))
+	if err != nil {
+		t.Fatalf("vtodoToTodo: %v", err)
+	}
+
+	if out.UID != in.UID {
+		t.Errorf("UID = %q, want %q", out.UID, in.UID)
+	}
+	if out.Summary != in.Summary {
+		t.Errorf("Summary = %q, want %q", out.Summary, in.Summary)
+	}
+	if out.Details != in.Details {
+		t.Errorf("Details = %q, want %q", out.Details, in.Details)
+	}
+	if out.Priority != in.Priority {
+		t.Errorf("Priority = %d, want %d", out.Priority, in.Priority)
+	}
+	if !out.Deadline.Equal(in.Deadline) {
+		t.Errorf("Deadline = %v, want %v", out.Deadline, in.Deadline)
+	}
+	if out.RRule != in.RRule {
+		t.Errorf("RRule = %q, want %q", out.RRule, in.RRule)
+	}
+}
+
+func TestVTODORoundTripNoRRule(t *testing.T) {
+	in := Todo{UID: "test-uid-2", Summary: "one-off task"}
+
+	out, err := vtodoToTodo(todoToVTODO(in))
+	if err != nil {
+		t.Fatalf("vtodoToTodo: %v", err)
+	}
+	if out.RRule != "" {
+		t.Errorf("RRule = %q, want empty for a non-recurring todo", out.RRule)
+	}
+}
+
+func TestFoldLineRespectsRuneBoundaries(t *testing.T) {
+	// Built so the limit=75 cut point lands mid-character if foldLine
+	// slices by raw byte offset instead of walking back to a rune start.
+	s := strings.Repeat("a", 70) + "héllo wörld... 漢字"
+
+	folded := foldLine(s)
+	for _, line := range strings.Split(folded, "\r\n") {
+		line = strings.TrimPrefix(line, " ")
+		if !utf8.ValidString(line) {
+			t.Fatalf("folded line is not valid UTF-8: %q", line)
+		}
+	}
+
+	var unfolded strings.Builder
+	for _, line := range strings.Split(folded, "\r\n") {
+		unfolded.WriteString(strings.TrimPrefix(line, " "))
+	}
+	if unfolded.String() != s {
+		t.Fatalf("unfolded = %q, want %q", unfolded.String(), s)
+	}
+}
+
+func TestVTODORoundTripMultibyteSummary(t *testing.T) {
+	in := Todo{UID: "test-uid-utf8", Summary: strings.Repeat("a", 70) + "héllo wörld... 漢字"}
+
+	out, err := vtodoToTodo(todoToVTODO(in))
+	if err != nil {
+		t.Fatalf("vtodoToTodo: %v", err)
+	}
+	if out.Summary != in.Summary {
+		t.Errorf("Summary = %q, want %q", out.Summary, in.Summary)
+	}
+}
+
+func TestVTODOIgnoresInvalidRRule(t *testing.T) {
+	ics := "BEGIN:VTODO\r\nUID:bad-rrule\r\nSUMMARY:broken\r\nRRULE:NOT-A-RRULE\r\nEND:VTODO\r\n"
+	out, err := vtodoToTodo(ics)
+	if err != nil {
+		t.Fatalf("vtodoToTodo: %v", err)
+	}
+	if out.RRule != "" {
+		t.Errorf("RRule = %q, want empty for an unparsable RRULE property", out.RRule)
+	}
+}
+
+func TestRenderParseCalendarRoundTrip(t *testing.T) {
+	todos := []Todo{
+		{UID: "a", Summary: "first", Priority: 1},
+		{UID: "b", Summary: "second", Priority: 5, RRule: "FREQ=WEEKLY;BYDAY=MO,WE,FR"},
+	}
+
+	got := ParseCalendar([]byte(RenderCalendar(todos)))
+	if len(got) != len(todos) {
+		t.Fatalf("got %d todos, want %d", len(got), len(todos))
+	}
+	for i, want := range todos {
+		if got[i].UID != want.UID || got[i].Summary != want.Summary || got[i].RRule != want.RRule {
+			t.Errorf("todo %d = %+v, want UID/Summary/RRule matching %+v", i, got[i], want)
+		}
+	}
+}
+
+func TestMergeImportedTodos(t *testing.T) {
+	existing := []Todo{
+		{UID: "keep", Summary: "unchanged"},
+		{UID: "update-me", Summary: "old summary"},
+	}
+	imported := []Todo{
+		{UID: "update-me", Summary: "new summary"},
+		{UID: "new-one", Summary: "brand new"},
+	}
+
+	merged, created, updated := mergeImportedTodos(existing, imported)
+
+	if created != 1 {
+		t.Errorf("created = %d, want 1", created)
+	}
+	if updated != 1 {
+		t.Errorf("updated = %d, want 1", updated)
+	}
+	if len(merged) != 3 {
+		t.Fatalf("len(merged) = %d, want 3", len(merged))
+	}
+
+	byUID := make(map[string]Todo, len(merged))
+	for _, t := range merged {
+		byUID[t.UID] = t
+	}
+	if byUID["keep"].Summary != "unchanged" {
+		t.Errorf("keep.Summary = %q, want unchanged", byUID["keep"].Summary)
+	}
+	if byUID["update-me"].Summary != "new summary" {
+		t.Errorf("update-me.Summary = %q, want new summary", byUID["update-me"].Summary)
+	}
+	if byUID["new-one"].Summary != "brand new" {
+		t.Errorf("new-one.Summary = %q, want brand new", byUID["new-one"].Summary)
+	}
+}
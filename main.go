@@ -2,9 +2,10 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"crypto/md5"
+	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"html"
@@ -14,11 +15,12 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"sort"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
 	"github.com/alexflint/go-arg"
@@ -37,6 +39,25 @@ type Todo struct {
 	Done     bool
 	Summary  string
 	Details  string
+
+	// UID is a stable identifier used to match todos against external
+	// representations (CalDAV resources, iCal VTODOs). Older entries on
+	// disk may predate this field and are backfilled on load.
+	UID string
+
+	// LastSync and ETag track the most recent CalDAV sync of this todo,
+	// so caldavSync can tell an unchanged item from a conflicting one.
+	LastSync time.Time
+	ETag     string
+
+	// RRule is an RFC 5545 recurrence rule (e.g. "FREQ=WEEKLY;BYDAY=MO,WE,FR").
+	// When set, completing this todo spawns a new pending instance at the
+	// next occurrence instead of just marking it done; see nextOccurrence.
+	RRule string
+
+	// RRuleRemaining counts occurrences left for an RRule with COUNT set.
+	// It is 0 for non-counted rules (unlimited, or bounded only by UNTIL).
+	RRuleRemaining int
 }
 
 type TodoPatch struct {
@@ -45,6 +66,7 @@ type TodoPatch struct {
 	Details  *string
 	Priority *int8
 	Deadline *time.Time
+	RRule    *string
 }
 
 func (x Todo) Print() {
@@ -63,6 +85,9 @@ func (x Todo) PrintAll() {
 	fmt.Printf("added at   %s\n", x.AddedAt.Format(dateYYYYMMDD))
 	fmt.Printf("deadline   %s\n", x.Deadline.Format(dateYYYYMMDD))
 	fmt.Printf("priority   %d\n", x.Priority)
+	if x.RRule != "" {
+		fmt.Printf("repeats    %s\n", x.RRule)
+	}
 }
 
 // Validation functions
@@ -136,13 +161,41 @@ func sortTodos(todos []Todo) []Todo {
 }
 
 
-func patchTodos(todos []Todo, match string, patch TodoPatch) int {
+// patchTodos applies patch to every todo matching summary. When a recurring
+// todo (RRule set) transitions to done, the completed instance is kept as-is
+// and a new pending instance at the next occurrence is appended to the
+// returned slice; see nextOccurrence.
+func patchTodos(todos []Todo, match string, patch TodoPatch) ([]Todo, int) {
 	updated := 0
 	now := time.Now()
+	var spawned []Todo
+
+	// A completed recurring todo keeps the same Summary as the pending
+	// instance spawned in its place, so more than one row can match. When
+	// that happens, a done-flag patch must land on the pending row only —
+	// otherwise "complete" on the active instance also flips the archived
+	// one back open as a side effect of the summary match. A lone already-
+	// done match (no recurring pending sibling) is unambiguous and can
+	// still be reopened.
+	togglingDone := patch.Done != nil && *patch.Done
+	hasPendingMatch := false
+	if togglingDone {
+		for _, t := range todos {
+			if t.Summary == match && !t.Done {
+				hasPendingMatch = true
+				break
+			}
+		}
+	}
+
 	for i := range todos {
 		if todos[i].Summary != match {
 			continue
 		}
+		if togglingDone && hasPendingMatch && todos[i].Done {
+			continue
+		}
+		completing := patch.Done != nil && *patch.Done && !todos[i].Done
 		if patch.Done != nil {
 			if *patch.Done {
 				if !todos[i].Done {
@@ -166,9 +219,21 @@ func patchTodos(todos []Todo, match string, patch TodoPatch) int {
 		if patch.Deadline != nil {
 			todos[i].Deadline = *patch.Deadline
 		}
+		if patch.RRule != nil {
+			todos[i].RRule = *patch.RRule
+		}
 		updated++
+
+		if completing {
+			if next, ok := nextOccurrence(todos[i], now); ok {
+				spawned = append(spawned, next)
+			}
+		}
+	}
+	if len(spawned) > 0 {
+		todos = append(todos, spawned...)
 	}
-	return updated
+	return todos, updated
 }
 
 func deleteTodos(todos []Todo, summary string) ([]Todo, int) {
@@ -193,46 +258,24 @@ func findFirstTodo(todos []Todo, summary string) (Todo, bool) {
 	return Todo{}, false
 }
 
-func dump(todos []Todo) {
-	f, err := os.Create(dataFile)
-	if err != nil {
-		log.Println("create file:", err)
-		return
-	}
-	defer f.Close()
-
-	b, err := json.Marshal(todos)
-	if err != nil {
-		log.Println(err)
+// newUID returns a randomly generated identifier suitable for a Todo.UID.
+func newUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
 	}
-	_, _ = f.Write(b)
+	return hex.EncodeToString(b)
 }
 
-func load(filename string) ([]Todo, error) {
-	f, err := os.Open(filename)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return []Todo{}, nil
-		}
-		return nil, err
+func addTodoOperation(store Store, summary, details, deadlineStr, priorityStr, rruleStr string) (string, error) {
+	if strings.TrimSpace(summary) == "" {
+		return "", errors.New("summary is required")
 	}
-	defer f.Close()
 
-	dec := json.NewDecoder(f)
-	var todos []Todo
-	if err := dec.Decode(&todos); err != nil {
-		// If file is empty, treat as no todos
-		if errors.Is(err, io.EOF) {
-			return []Todo{}, nil
+	if rruleStr != "" {
+		if _, err := ParseRRule(rruleStr); err != nil {
+			return "", fmt.Errorf("invalid rrule: %w", err)
 		}
-		return nil, err
-	}
-	return todos, nil
-}
-
-func addTodoOperation(todos *[]Todo, mu *sync.Mutex, summary, details, deadlineStr, priorityStr string) (string, error) {
-	if strings.TrimSpace(summary) == "" {
-		return "", errors.New("summary is required")
 	}
 
 	deadline, err := stringToDeadline(deadlineStr)
@@ -267,32 +310,32 @@ func addTodoOperation(todos *[]Todo, mu *sync.Mutex, summary, details, deadlineS
 		Done:     false,
 		Summary:  strings.TrimSpace(summary),
 		Details:  details,
+		UID:      newUID(),
+		RRule:    rruleStr,
 	}
 
-	mu.Lock()
-	*todos = append(*todos, newTodo)
-	dump(*todos)
-	mu.Unlock()
+	if _, err := store.Add(newTodo); err != nil {
+		return "", err
+	}
+	hub.Publish(Event{Type: "created", Summary: newTodo.Summary})
 
 	return "todo added", nil
 }
 
-func deleteTodoOperation(todos *[]Todo, mu *sync.Mutex, summary string) string {
-	mu.Lock()
-	newTodos, removed := deleteTodos(*todos, summary)
-	if removed > 0 {
-		*todos = newTodos
-		dump(*todos)
+func deleteTodoOperation(store Store, summary string, ifMatch string) (string, error) {
+	removed, err := store.Delete(summary, ifMatch)
+	if err != nil {
+		return "", err
 	}
-	mu.Unlock()
 
 	if removed == 0 {
-		return fmt.Sprintf("no todo found with summary: %q", summary)
+		return fmt.Sprintf("no todo found with summary: %q", summary), nil
 	}
-	return fmt.Sprintf("deleted %d todo(s) with summary %q", removed, summary)
+	hub.Publish(Event{Type: "deleted", Summary: summary})
+	return fmt.Sprintf("deleted %d todo(s) with summary %q", removed, summary), nil
 }
 
-func setTodoOperation(todos *[]Todo, mu *sync.Mutex, match string, patch TodoPatch) (string, error) {
+func setTodoOperation(store Store, match string, patch TodoPatch, ifMatch string) (string, error) {
 	if patch.Priority != nil {
 		if !isValidPriority(*patch.Priority) {
 			return "", errors.New("priority out of range (1-5)")
@@ -309,16 +352,21 @@ func setTodoOperation(todos *[]Todo, mu *sync.Mutex, match string, patch TodoPat
 		return "", errors.New("summary cannot be empty")
 	}
 
-	mu.Lock()
-	updated := patchTodos(*todos, match, patch)
-	if updated > 0 {
-		dump(*todos)
+	if patch.RRule != nil && *patch.RRule != "" {
+		if _, err := ParseRRule(*patch.RRule); err != nil {
+			return "", fmt.Errorf("invalid rrule: %w", err)
+		}
+	}
+
+	updated, err := store.Update(match, patch, ifMatch)
+	if err != nil {
+		return "", err
 	}
-	mu.Unlock()
 
 	if updated == 0 {
 		return fmt.Sprintf("no todo found with summary: %q", match), nil
 	}
+	hub.Publish(Event{Type: "updated", Summary: match})
 	return fmt.Sprintf("updated %d todo(s) with summary %q", updated, match), nil
 }
 
@@ -369,6 +417,11 @@ func paramsToPatch(params url.Values) (TodoPatch, error) {
 		patch.Deadline = dl
 	}
 
+	if _, ok := params["rrule"]; ok {
+		r := params.Get("rrule")
+		patch.RRule = &r
+	}
+
 	return patch, nil
 }
 
@@ -414,11 +467,22 @@ func main() {
 	type ServeCmd struct{}
 	type AddCmd struct{}
 	type ListCmd struct {
-		All bool `arg:"-a" help:"list done todos"`
+		All      bool `arg:"-a" help:"list done todos"`
+		Upcoming int  `arg:"--upcoming" help:"preview the next N occurrences of each recurring todo"`
 	}
 	type DeleteCmd struct {
 		Summary string `arg:"positional,required" help:"summary of the todo(s) to delete"`
 	}
+	type SearchCmd struct {
+		Query string `arg:"positional,required" help:"substring to search for in summary/details"`
+	}
+	type ExportCmd struct {
+		Format string `arg:"--format" help:"export format, only \"ics\" is supported"`
+		Out    string `arg:"--out" help:"output file (default stdout)"`
+	}
+	type ImportCmd struct {
+		File string `arg:"positional,required" help:"ICS file to import"`
+	}
 	type SetCmd struct {
 		Match    string  `arg:"positional,required" help:"summary of the todo(s) to update"`
 		Done     *bool   `arg:"--done" help:"toggle done status"`
@@ -426,22 +490,37 @@ func main() {
 		Details  *string `arg:"--details"`
 		Priority *int8   `arg:"--priority"`
 		Deadline *string `arg:"--deadline"`
+		RRule    *string `arg:"--rrule" help:"RFC 5545 recurrence rule, empty string clears it"`
+	}
+	type CaldavSyncCmd struct {
+		URL       string `arg:"--url,required" help:"base URL of the calendar collection"`
+		User      string `arg:"--user,required" help:"basic auth username"`
+		Pass      string `arg:"--pass" help:"basic auth password"`
+		Calendar  string `arg:"--calendar" help:"calendar name/path under the base URL"`
+		LocalWins bool   `arg:"--local-wins" help:"on conflict, keep the local copy instead of the remote one"`
+	}
+	type CaldavCmd struct {
+		Sync *CaldavSyncCmd `arg:"subcommand:sync" help:"sync ~/.gotodo.json with a CalDAV calendar"`
 	}
 
 	var args struct {
+		Store  string     `arg:"--store" help:"storage backend: json or sqlite (default json, or $GOTODO_STORE)"`
 		Serve  *ServeCmd  `arg:"subcommand:serve" help:"start local web server"`
 		Add    *AddCmd    `arg:"subcommand:add" help:"add a new todo"`
 		Delete *DeleteCmd `arg:"subcommand:delete" help:"delete todo(s) by summary"`
 		Set    *SetCmd    `arg:"subcommand:set" help:"update properties of todo(s) by summary"`
 		List   *ListCmd   `arg:"subcommand:list" help:"list todos"`
+		Search *SearchCmd `arg:"subcommand:search" help:"search todos by summary/details substring"`
+		Caldav *CaldavCmd `arg:"subcommand:caldav" help:"sync todos with a CalDAV server"`
+		Export *ExportCmd `arg:"subcommand:export" help:"export todos as an iCalendar (.ics) file"`
+		Import *ImportCmd `arg:"subcommand:import" help:"import todos from an iCalendar (.ics) file"`
 	}
 	arg.MustParse(&args)
 
-	todos, err := load(dataFile)
+	store, err := openStore(args.Store)
 	if err != nil {
-		log.Println("load", err)
+		log.Fatalf("open store: %v", err)
 	}
-	var mu sync.Mutex
 
 	switch {
 	case args.Serve != nil:
@@ -460,14 +539,18 @@ func main() {
 			showAll := isTrue(r.URL.Query().Get("all"))
 			flash := r.URL.Query().Get("flash")
 
-			mu.Lock()
+			todos, err := store.List()
+			if err != nil {
+				http.Error(w, "list todos", http.StatusInternalServerError)
+				log.Println("list todos:", err)
+				return
+			}
 			data := IndexData{
 				Today:   time.Now().Format(dateYYYYMMDD),
 				ShowAll: showAll,
 				Flash:   flash,
-				Todos:   append([]Todo(nil), sortTodos(todos)...),
+				Todos:   sortTodos(todos),
 			}
-			mu.Unlock()
 
 			if err := tmpl.ExecuteTemplate(w, "index.html", data); err != nil {
 				http.Error(w, "template error", http.StatusInternalServerError)
@@ -487,9 +570,12 @@ func main() {
 				return
 			}
 
-			mu.Lock()
-			example, ok := findFirstTodo(todos, match)
-			mu.Unlock()
+			example, ok, err := store.Get(match)
+			if err != nil {
+				http.Error(w, "get todo", http.StatusInternalServerError)
+				log.Println("get todo:", err)
+				return
+			}
 			if !ok {
 				http.NotFound(w, r)
 				return
@@ -517,11 +603,12 @@ func main() {
 				return
 			}
 
-			message, err := addTodoOperation(&todos, &mu,
+			message, err := addTodoOperation(store,
 				r.Form.Get("summary"),
 				r.Form.Get("details"),
 				r.Form.Get("deadline"),
 				r.Form.Get("priority"),
+				r.Form.Get("rrule"),
 			)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
@@ -543,7 +630,11 @@ func main() {
 				return
 			}
 
-			message := deleteTodoOperation(&todos, &mu, match)
+			message, err := deleteTodoOperation(store, match, "")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
 
 			http.Redirect(w, r, "/?flash="+url.QueryEscape(message), http.StatusSeeOther)
 		})
@@ -568,7 +659,7 @@ func main() {
 				return
 			}
 
-			message, err := setTodoOperation(&todos, &mu, match, patch)
+			message, err := setTodoOperation(store, match, patch, "")
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
@@ -577,8 +668,68 @@ func main() {
 			http.Redirect(w, r, "/?flash="+url.QueryEscape(message), http.StatusSeeOther)
 		})
 
+		http.HandleFunc("/api/caldav/sync", caldavSyncHTTP(store.(bulkStore)))
+
+		registerAPIRoutes(store)
+
+		http.HandleFunc("/ws", wsHandler)
+
+		http.HandleFunc("/api/export.ics", func(w http.ResponseWriter, r *http.Request) {
+			todos, err := store.List()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+			io.WriteString(w, RenderCalendar(todos))
+		})
+
+		http.HandleFunc("/api/import", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			existing, err := store.List()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			merged, created, updated := mergeImportedTodos(existing, ParseCalendar(data))
+			if err := store.(bulkStore).ReplaceAll(merged); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if created+updated > 0 {
+				hub.Publish(Event{Type: "imported"})
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"created":%d,"updated":%d}`, created, updated)
+		})
+
+		srv := &http.Server{Addr: ":8080"}
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		go func() {
+			<-ctx.Done()
+			log.Println("shutting down")
+			hub.Close()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				log.Println("shutdown:", err)
+			}
+		}()
+
 		log.Println("serving on http://localhost:8080")
-		log.Fatal(http.ListenAndServe(":8080", nil))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
 
 	case args.Add != nil:
 		reader := bufio.NewReader(os.Stdin)
@@ -607,7 +758,13 @@ func main() {
 			break
 		}
 
-		message, err := addTodoOperation(&todos, &mu, summary, details, deadline, priority)
+		rrule, err := readLine(reader, "rrule (RFC 5545, optional): ")
+		if err != nil {
+			log.Println("add:", err)
+			break
+		}
+
+		message, err := addTodoOperation(store, summary, details, deadline, priority, rrule)
 		if err != nil {
 			log.Println("add:", err)
 		} else {
@@ -615,6 +772,23 @@ func main() {
 		}
 
 	case args.List != nil:
+		todos, err := store.List()
+		if err != nil {
+			log.Println("list:", err)
+			break
+		}
+		if args.List.Upcoming > 0 {
+			for _, todo := range sortTodos(todos) {
+				if todo.RRule == "" {
+					continue
+				}
+				fmt.Printf("%s (%s):\n", todo.Summary, todo.RRule)
+				for _, t := range upcomingOccurrences(todo, args.List.Upcoming) {
+					fmt.Printf("  %s\n", t.Format(dateYYYYMMDD))
+				}
+			}
+			break
+		}
 		for _, todo := range sortTodos(todos) {
 			if args.List.All {
 				todo.PrintAll()
@@ -625,13 +799,27 @@ func main() {
 			}
 		}
 
+	case args.Search != nil:
+		found, err := searchTodos(store, args.Search.Query)
+		if err != nil {
+			log.Println("search:", err)
+			break
+		}
+		for _, todo := range sortTodos(found) {
+			todo.Print()
+		}
+
 	case args.Delete != nil:
-		message := deleteTodoOperation(&todos, &mu, args.Delete.Summary)
-		fmt.Println(message)
+		message, err := deleteTodoOperation(store, args.Delete.Summary, "")
+		if err != nil {
+			log.Println("delete:", err)
+		} else {
+			fmt.Println(message)
+		}
 
 	case args.Set != nil:
-		if args.Set.Done == nil && args.Set.Summary == nil && args.Set.Details == nil && args.Set.Priority == nil && args.Set.Deadline == nil {
-			log.Println("set: no fields provided; use --done/--summary/--details/--priority/--deadline")
+		if args.Set.Done == nil && args.Set.Summary == nil && args.Set.Details == nil && args.Set.Priority == nil && args.Set.Deadline == nil && args.Set.RRule == nil {
+			log.Println("set: no fields provided; use --done/--summary/--details/--priority/--deadline/--rrule")
 			break
 		}
 
@@ -640,6 +828,7 @@ func main() {
 			Summary:  args.Set.Summary,
 			Details:  args.Set.Details,
 			Priority: args.Set.Priority,
+			RRule:    args.Set.RRule,
 		}
 
 		if args.Set.Deadline != nil {
@@ -651,11 +840,62 @@ func main() {
 			patch.Deadline = dl
 		}
 
-		message, err := setTodoOperation(&todos, &mu, args.Set.Match, patch)
+		message, err := setTodoOperation(store, args.Set.Match, patch, "")
 		if err != nil {
 			log.Println("set:", err)
 		} else {
 			fmt.Println(message)
 		}
+
+	case args.Caldav != nil && args.Caldav.Sync != nil:
+		s := args.Caldav.Sync
+		if err := parseURLOrEmpty(s.URL); err != nil {
+			log.Println("caldav sync: invalid --url:", err)
+			break
+		}
+		cfg := CalDAVConfig{URL: s.URL, User: s.User, Pass: s.Pass, Calendar: s.Calendar}
+		message, err := caldavSync(store.(bulkStore), cfg, s.LocalWins)
+		if err != nil {
+			log.Println("caldav sync:", err)
+		} else {
+			fmt.Println(message)
+		}
+
+	case args.Export != nil:
+		if args.Export.Format != "" && args.Export.Format != "ics" {
+			log.Printf("export: unsupported format %q (only ics)", args.Export.Format)
+			break
+		}
+		todos, err := store.List()
+		if err != nil {
+			log.Println("export:", err)
+			break
+		}
+		data := RenderCalendar(todos)
+		if args.Export.Out == "" {
+			fmt.Print(data)
+			break
+		}
+		if err := os.WriteFile(args.Export.Out, []byte(data), 0644); err != nil {
+			log.Println("export:", err)
+		}
+
+	case args.Import != nil:
+		data, err := os.ReadFile(args.Import.File)
+		if err != nil {
+			log.Println("import:", err)
+			break
+		}
+		existing, err := store.List()
+		if err != nil {
+			log.Println("import:", err)
+			break
+		}
+		merged, created, updated := mergeImportedTodos(existing, ParseCalendar(data))
+		if err := store.(bulkStore).ReplaceAll(merged); err != nil {
+			log.Println("import:", err)
+			break
+		}
+		fmt.Printf("import: %d created, %d updated\n", created, updated)
 	}
 }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RRule is a parsed RFC 5545 recurrence rule. Only the subset gotodo needs
+// is supported: FREQ, INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL.
+type RRule struct {
+	Freq       string // DAILY, WEEKLY, MONTHLY, YEARLY
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	Count      int       // 0 = unbounded
+	Until      time.Time // zero = unbounded
+}
+
+var byDayCodes = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// ParseRRule parses a single-line RRULE value such as
+// "FREQ=WEEKLY;BYDAY=MO,WE,FR" or "FREQ=MONTHLY;BYMONTHDAY=1;COUNT=12".
+func ParseRRule(s string) (RRule, error) {
+	r := RRule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return RRule{}, fmt.Errorf("empty rrule")
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return RRule{}, fmt.Errorf("malformed rrule part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return RRule{}, fmt.Errorf("invalid INTERVAL %q", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return RRule{}, fmt.Errorf("invalid COUNT %q", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseICalTime(value)
+			if err != nil {
+				return RRule{}, fmt.Errorf("invalid UNTIL %q", value)
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				wd, ok := byDayCodes[strings.ToUpper(d)]
+				if !ok {
+					return RRule{}, fmt.Errorf("invalid BYDAY %q", d)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil {
+					return RRule{}, fmt.Errorf("invalid BYMONTHDAY %q", d)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		}
+	}
+
+	switch r.Freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return RRule{}, fmt.Errorf("unsupported or missing FREQ %q", r.Freq)
+	}
+	return r, nil
+}
+
+// maxCandidates bounds how far Next will walk forward before giving up,
+// so a rule whose BY* filters never match (e.g. BYMONTHDAY=31 on FREQ=MONTHLY
+// combined with a short INTERVAL) can't loop forever.
+const maxCandidates = 5 * 366
+
+// Next returns the first occurrence strictly after `after` that satisfies
+// the rule's BYDAY/BYMONTHDAY filters, INTERVAL spacing and UNTIL bound.
+func (r RRule) Next(after time.Time) (time.Time, bool) {
+	candidate := after
+	step := func() {
+		switch r.Freq {
+		case "DAILY":
+			candidate = candidate.AddDate(0, 0, r.Interval)
+		case "WEEKLY":
+			if len(r.ByDay) > 0 {
+				candidate = candidate.AddDate(0, 0, 1)
+			} else {
+				candidate = candidate.AddDate(0, 0, 7*r.Interval)
+			}
+		case "MONTHLY":
+			if len(r.ByMonthDay) > 0 {
+				candidate = candidate.AddDate(0, 0, 1)
+			} else {
+				candidate = candidate.AddDate(0, r.Interval, 0)
+			}
+		case "YEARLY":
+			candidate = candidate.AddDate(r.Interval, 0, 0)
+		}
+	}
+
+	for i := 0; i < maxCandidates; i++ {
+		step()
+		if !r.Until.IsZero() && candidate.After(r.Until) {
+			return time.Time{}, false
+		}
+		if r.matches(candidate) && r.intervalAligned(after, candidate) {
+			return candidate, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// intervalAligned reports whether candidate falls in a week (for WEEKLY
+// BYDAY rules) or month (for MONTHLY BYMONTHDAY rules) that is an exact
+// multiple of r.Interval away from anchor's own week/month. The DAILY,
+// YEARLY and plain WEEKLY/MONTHLY (no BYDAY/BYMONTHDAY) cases already
+// advance by Interval directly in step, so they're always aligned.
+func (r RRule) intervalAligned(anchor, candidate time.Time) bool {
+	switch r.Freq {
+	case "WEEKLY":
+		if len(r.ByDay) == 0 {
+			return true
+		}
+		weeks := int(weekStart(candidate).Sub(weekStart(anchor)).Hours() / 24 / 7)
+		return weeks%r.Interval == 0
+	case "MONTHLY":
+		if len(r.ByMonthDay) == 0 {
+			return true
+		}
+		months := (candidate.Year()-anchor.Year())*12 + int(candidate.Month()-anchor.Month())
+		return months%r.Interval == 0
+	default:
+		return true
+	}
+}
+
+// weekStart returns the midnight of the Sunday beginning t's week.
+func weekStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	return midnight.AddDate(0, 0, -int(t.Weekday()))
+}
+
+func (r RRule) matches(t time.Time) bool {
+	if len(r.ByDay) > 0 {
+		found := false
+		for _, d := range r.ByDay {
+			if d == t.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.ByMonthDay) > 0 {
+		found := false
+		for _, d := range r.ByMonthDay {
+			if d == t.Day() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// nextOccurrence computes the replacement todo to create when a recurring
+// todo is marked done, decrementing any COUNT-based budget carried on the
+// todo. ok is false when the todo isn't recurring, its RRule fails to
+// parse, or the series has ended (COUNT exhausted or Next hit UNTIL).
+func nextOccurrence(t Todo, now time.Time) (Todo, bool) {
+	if t.RRule == "" {
+		return Todo{}, false
+	}
+	rule, err := ParseRRule(t.RRule)
+	if err != nil {
+		return Todo{}, false
+	}
+
+	remaining := t.RRuleRemaining
+	if rule.Count > 0 {
+		if remaining <= 0 {
+			remaining = rule.Count
+		}
+		remaining--
+		if remaining <= 0 {
+			return Todo{}, false
+		}
+	}
+
+	next, ok := rule.Next(t.Deadline)
+	if !ok {
+		return Todo{}, false
+	}
+
+	return Todo{
+		Priority:       t.Priority,
+		Deadline:       next,
+		AddedAt:        now,
+		Done:           false,
+		Summary:        t.Summary,
+		Details:        t.Details,
+		RRule:          t.RRule,
+		RRuleRemaining: remaining,
+		UID:            newUID(),
+	}, true
+}
+
+// upcomingOccurrences previews up to n future occurrences of a recurring
+// todo, starting strictly after its current deadline.
+func upcomingOccurrences(t Todo, n int) []time.Time {
+	if t.RRule == "" || n <= 0 {
+		return nil
+	}
+	rule, err := ParseRRule(t.RRule)
+	if err != nil {
+		return nil
+	}
+
+	out := make([]time.Time, 0, n)
+	from := t.Deadline
+	for len(out) < n {
+		next, ok := rule.Next(from)
+		if !ok {
+			break
+		}
+		out = append(out, next)
+		from = next
+	}
+	return out
+}
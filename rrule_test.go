@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParseRRule(t *testing.T, s string) RRule {
+	t.Helper()
+	r, err := ParseRRule(s)
+	if err != nil {
+		t.Fatalf("ParseRRule(%q): %v", s, err)
+	}
+	return r
+}
+
+func TestRRuleNext(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name  string
+		rrule string
+		after time.Time
+		want  time.Time
+	}{
+		{
+			name:  "daily interval 3",
+			rrule: "FREQ=DAILY;INTERVAL=3",
+			after: day(2026, time.July, 1),
+			want:  day(2026, time.July, 4),
+		},
+		{
+			name:  "weekly no byday",
+			rrule: "FREQ=WEEKLY;INTERVAL=2",
+			after: day(2026, time.July, 27), // Monday
+			want:  day(2026, time.August, 10),
+		},
+		{
+			name:  "weekly byday interval 1",
+			rrule: "FREQ=WEEKLY;BYDAY=MO",
+			after: day(2026, time.July, 27), // Monday
+			want:  day(2026, time.August, 3),
+		},
+		{
+			name:  "weekly byday interval 2 skips the in-between week",
+			rrule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO",
+			after: day(2026, time.July, 27), // Monday
+			want:  day(2026, time.August, 10),
+		},
+		{
+			name:  "monthly bymonthday interval 1",
+			rrule: "FREQ=MONTHLY;BYMONTHDAY=15",
+			after: day(2026, time.July, 15),
+			want:  day(2026, time.August, 15),
+		},
+		{
+			name:  "monthly bymonthday interval 2 skips the in-between month",
+			rrule: "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=15",
+			after: day(2026, time.July, 15),
+			want:  day(2026, time.September, 15),
+		},
+		{
+			name:  "yearly interval 1",
+			rrule: "FREQ=YEARLY",
+			after: day(2026, time.July, 15),
+			want:  day(2027, time.July, 15),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := mustParseRRule(t, tc.rrule)
+			got, ok := r.Next(tc.after)
+			if !ok {
+				t.Fatalf("Next(%v) = not ok, want %v", tc.after, tc.want)
+			}
+			if !got.Equal(tc.want) {
+				t.Fatalf("Next(%v) = %v, want %v", tc.after, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRRuleNextUntil(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	r := mustParseRRule(t, "FREQ=DAILY;UNTIL=20260702T000000Z")
+
+	if _, ok := r.Next(day(2026, time.July, 1)); !ok {
+		t.Fatal("expected an occurrence before UNTIL")
+	}
+	if _, ok := r.Next(day(2026, time.July, 2)); ok {
+		t.Fatal("expected no occurrence past UNTIL")
+	}
+}
+
+func TestNextOccurrenceDecrementsCount(t *testing.T) {
+	now := time.Date(2026, time.July, 20, 0, 0, 0, 0, time.UTC)
+	todo := Todo{
+		Summary:  "water plants",
+		RRule:    "FREQ=DAILY;COUNT=2",
+		Deadline: time.Date(2026, time.July, 19, 0, 0, 0, 0, time.UTC),
+	}
+
+	next, ok := nextOccurrence(todo, now)
+	if !ok {
+		t.Fatal("expected a next occurrence for the first completion")
+	}
+	if next.RRuleRemaining != 1 {
+		t.Fatalf("RRuleRemaining = %d, want 1", next.RRuleRemaining)
+	}
+
+	_, ok = nextOccurrence(next, now)
+	if ok {
+		t.Fatal("expected the series to end once COUNT is exhausted")
+	}
+}
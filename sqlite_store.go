@@ -0,0 +1,347 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS todos (
+	id        INTEGER PRIMARY KEY,
+	uid       TEXT UNIQUE NOT NULL,
+	summary   TEXT NOT NULL,
+	details   TEXT NOT NULL DEFAULT '',
+	priority  INTEGER NOT NULL DEFAULT 1,
+	deadline  TEXT NOT NULL DEFAULT '',
+	added_at  TEXT NOT NULL DEFAULT '',
+	done_at   TEXT NOT NULL DEFAULT '',
+	done      INTEGER NOT NULL DEFAULT 0,
+	last_sync TEXT NOT NULL DEFAULT '',
+	etag      TEXT NOT NULL DEFAULT '',
+	rrule     TEXT NOT NULL DEFAULT '',
+	rrule_remaining INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_todos_done ON todos(done);
+CREATE INDEX IF NOT EXISTS idx_todos_deadline ON todos(deadline);
+CREATE INDEX IF NOT EXISTS idx_todos_priority ON todos(priority);
+CREATE VIRTUAL TABLE IF NOT EXISTS todos_fts USING fts5(
+	summary, details, content='todos', content_rowid='id'
+);
+CREATE TRIGGER IF NOT EXISTS todos_ai AFTER INSERT ON todos BEGIN
+	INSERT INTO todos_fts(rowid, summary, details) VALUES (new.id, new.summary, new.details);
+END;
+CREATE TRIGGER IF NOT EXISTS todos_ad AFTER DELETE ON todos BEGIN
+	INSERT INTO todos_fts(todos_fts, rowid, summary, details) VALUES ('delete', old.id, old.summary, old.details);
+END;
+CREATE TRIGGER IF NOT EXISTS todos_au AFTER UPDATE ON todos BEGIN
+	INSERT INTO todos_fts(todos_fts, rowid, summary, details) VALUES ('delete', old.id, old.summary, old.details);
+	INSERT INTO todos_fts(rowid, summary, details) VALUES (new.id, new.summary, new.details);
+END;
+`
+
+// sqliteStore is a modernc.org/sqlite (pure Go, no cgo) backed Store,
+// offering indexed lookups and FTS5 search where jsonStore only has a
+// linear scan over the whole file.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("init schema: %w", err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func formatTimeCol(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func parseTimeCol(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func (s *sqliteStore) Add(t Todo) (Todo, error) {
+	if t.UID == "" {
+		t.UID = newUID()
+	}
+	_, err := s.db.Exec(`INSERT INTO todos (uid, summary, details, priority, deadline, added_at, done_at, done, last_sync, etag, rrule, rrule_remaining)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.UID, t.Summary, t.Details, t.Priority, formatTimeCol(t.Deadline), formatTimeCol(t.AddedAt), formatTimeCol(t.DoneAt), boolToInt(t.Done), formatTimeCol(t.LastSync), t.ETag, t.RRule, t.RRuleRemaining)
+	return t, err
+}
+
+func (s *sqliteStore) Update(match string, patch TodoPatch, ifMatch string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(`SELECT id, uid, summary, details, priority, deadline, added_at, done_at, done, last_sync, etag, rrule, rrule_remaining FROM todos WHERE summary = ?`, match)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	var matches []Todo
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		t, err := scanTodo(rows, &id)
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return 0, err
+		}
+		matches = append(matches, t)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if len(matches) == 0 {
+		tx.Rollback()
+		return 0, nil
+	}
+	if ifMatch != "" && etagFor(matches[0]) != ifMatch {
+		tx.Rollback()
+		return 0, errETagMismatch
+	}
+
+	// See patchTodos' comment in main.go: a completed recurring todo keeps
+	// the pending instance's Summary, so a done-flag patch must not flip an
+	// archived done row back open as a side effect of matching by summary.
+	togglingDone := patch.Done != nil && *patch.Done
+	hasPendingMatch := false
+	if togglingDone {
+		for _, t := range matches {
+			if !t.Done {
+				hasPendingMatch = true
+				break
+			}
+		}
+	}
+
+	now := time.Now()
+	updated := 0
+	var spawn []Todo
+	for i, id := range ids {
+		original := matches[i]
+		if togglingDone && hasPendingMatch && original.Done {
+			continue
+		}
+		t := original
+		completing := patch.Done != nil && *patch.Done && !t.Done
+		applyPatch(&t, patch, now)
+		if _, err := tx.Exec(`UPDATE todos SET summary=?, details=?, priority=?, deadline=?, done_at=?, done=?, rrule=? WHERE id=?`,
+			t.Summary, t.Details, t.Priority, formatTimeCol(t.Deadline), formatTimeCol(t.DoneAt), boolToInt(t.Done), t.RRule, id); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		updated++
+		if completing {
+			if next, ok := nextOccurrence(t, now); ok {
+				spawn = append(spawn, next)
+			}
+		}
+	}
+	for _, t := range spawn {
+		if _, err := tx.Exec(`INSERT INTO todos (uid, summary, details, priority, deadline, added_at, done_at, done, last_sync, etag, rrule, rrule_remaining)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			t.UID, t.Summary, t.Details, t.Priority, formatTimeCol(t.Deadline), formatTimeCol(t.AddedAt), formatTimeCol(t.DoneAt), boolToInt(t.Done), formatTimeCol(t.LastSync), t.ETag, t.RRule, t.RRuleRemaining); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// applyPatch mirrors patchTodos' per-field merge semantics for a single todo.
+func applyPatch(t *Todo, patch TodoPatch, now time.Time) {
+	if patch.Done != nil && *patch.Done {
+		if !t.Done {
+			t.DoneAt = now
+			t.Done = true
+		} else {
+			t.Done = false
+			t.DoneAt = time.Time{}
+		}
+	}
+	if patch.Summary != nil {
+		t.Summary = *patch.Summary
+	}
+	if patch.Details != nil {
+		t.Details = *patch.Details
+	}
+	if patch.Priority != nil {
+		t.Priority = *patch.Priority
+	}
+	if patch.Deadline != nil {
+		t.Deadline = *patch.Deadline
+	}
+	if patch.RRule != nil {
+		t.RRule = *patch.RRule
+	}
+}
+
+func (s *sqliteStore) Delete(summary string, ifMatch string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	if ifMatch != "" {
+		row := tx.QueryRow(`SELECT id, uid, summary, details, priority, deadline, added_at, done_at, done, last_sync, etag, rrule, rrule_remaining FROM todos WHERE summary = ? LIMIT 1`, summary)
+		var id int64
+		current, err := scanTodo(row, &id)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			tx.Rollback()
+			return 0, err
+		}
+		if err == nil && etagFor(current) != ifMatch {
+			tx.Rollback()
+			return 0, errETagMismatch
+		}
+	}
+
+	res, err := tx.Exec(`DELETE FROM todos WHERE summary = ?`, summary)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+func (s *sqliteStore) List() ([]Todo, error) {
+	rows, err := s.db.Query(`SELECT id, uid, summary, details, priority, deadline, added_at, done_at, done, last_sync, etag, rrule, rrule_remaining FROM todos`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Todo
+	for rows.Next() {
+		var id int64
+		t, err := scanTodo(rows, &id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteStore) Get(summary string) (Todo, bool, error) {
+	row := s.db.QueryRow(`SELECT id, uid, summary, details, priority, deadline, added_at, done_at, done, last_sync, etag, rrule, rrule_remaining FROM todos WHERE summary = ? LIMIT 1`, summary)
+	var id int64
+	t, err := scanTodo(row, &id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Todo{}, false, nil
+	}
+	if err != nil {
+		return Todo{}, false, err
+	}
+	return t, true, nil
+}
+
+func (s *sqliteStore) Search(q string) ([]Todo, error) {
+	rows, err := s.db.Query(`SELECT t.id, t.uid, t.summary, t.details, t.priority, t.deadline, t.added_at, t.done_at, t.done, t.last_sync, t.etag, t.rrule, t.rrule_remaining
+		FROM todos t JOIN todos_fts f ON f.rowid = t.id WHERE todos_fts MATCH ?`, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Todo
+	for rows.Next() {
+		var id int64
+		t, err := scanTodo(rows, &id)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func (s *sqliteStore) ReplaceAll(todos []Todo) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM todos`); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, t := range todos {
+		if t.UID == "" {
+			t.UID = newUID()
+		}
+		if _, err := tx.Exec(`INSERT INTO todos (uid, summary, details, priority, deadline, added_at, done_at, done, last_sync, etag, rrule, rrule_remaining)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			t.UID, t.Summary, t.Details, t.Priority, formatTimeCol(t.Deadline), formatTimeCol(t.AddedAt), formatTimeCol(t.DoneAt), boolToInt(t.Done), formatTimeCol(t.LastSync), t.ETag, t.RRule, t.RRuleRemaining); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows, letting scanTodo
+// serve single-row and multi-row callers alike.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTodo(r rowScanner, id *int64) (Todo, error) {
+	var t Todo
+	var deadline, addedAt, doneAt, lastSync string
+	var done int
+	if err := r.Scan(id, &t.UID, &t.Summary, &t.Details, &t.Priority, &deadline, &addedAt, &doneAt, &done, &lastSync, &t.ETag, &t.RRule, &t.RRuleRemaining); err != nil {
+		return Todo{}, err
+	}
+	t.Deadline = parseTimeCol(deadline)
+	t.AddedAt = parseTimeCol(addedAt)
+	t.DoneAt = parseTimeCol(doneAt)
+	t.LastSync = parseTimeCol(lastSync)
+	t.Done = done != 0
+	return t, nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
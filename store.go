@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var sqliteFile = fmt.Sprintf("%s/.gotodo.db", homePath)
+
+// openStore picks a Store backend from the --store flag, falling back to
+// $GOTODO_STORE and then the json file, matching the CLI's preference for
+// flags over environment over a sensible default.
+func openStore(flag string) (Store, error) {
+	backend := flag
+	if backend == "" {
+		backend = os.Getenv("GOTODO_STORE")
+	}
+	if backend == "" {
+		backend = "json"
+	}
+
+	switch backend {
+	case "json":
+		return newJSONStore(dataFile), nil
+	case "sqlite":
+		return newSQLiteStore(sqliteFile)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q (want json or sqlite)", backend)
+	}
+}
+
+// Store is the persistence boundary for todos. Every CLI and HTTP operation
+// flows through a Store implementation rather than mutating an in-memory
+// slice directly, so swapping backends (the ~/.gotodo.json file, SQLite)
+// never touches caller code.
+//
+// Update and Delete take an ifMatch ETag (see etagFor): when non-empty, the
+// compare against the matched todo's current ETag happens under the same
+// lock as the mutation itself, so two concurrent callers can't both pass a
+// stale check. An empty ifMatch skips the check, as CLI and form callers
+// that have no ETag to offer do.
+type Store interface {
+	Add(t Todo) (Todo, error)
+	Update(match string, patch TodoPatch, ifMatch string) (int, error)
+	Delete(summary string, ifMatch string) (int, error)
+	List() ([]Todo, error)
+	Get(summary string) (Todo, bool, error)
+}
+
+// errETagMismatch is returned by Update/Delete when a non-empty ifMatch
+// doesn't match the matched todo's current ETag.
+var errETagMismatch = errors.New("etag mismatch")
+
+// bulkStore is an optional capability implemented by backends that can
+// replace the entire todo list atomically. It backs caldavSync, whose
+// merge result can touch additions, updates and deletions in one pass.
+type bulkStore interface {
+	Store
+	ReplaceAll(todos []Todo) error
+}
+
+// searcher is an optional capability implemented by backends with a more
+// efficient lookup than a linear scan, such as sqliteStore's FTS5 index.
+type searcher interface {
+	Search(q string) ([]Todo, error)
+}
+
+// searchTodos uses the store's own Search when available and otherwise
+// falls back to a case-insensitive substring scan over List.
+func searchTodos(store Store, q string) ([]Todo, error) {
+	if s, ok := store.(searcher); ok {
+		return s.Search(q)
+	}
+
+	all, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	needle := strings.ToLower(q)
+	var out []Todo
+	for _, t := range all {
+		if strings.Contains(strings.ToLower(t.Summary), needle) || strings.Contains(strings.ToLower(t.Details), needle) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// jsonStore is the original ~/.gotodo.json backend, now guarded by an
+// OS-level advisory lock (flock(2)) so concurrent gotodo processes and the
+// serve HTTP handlers can't interleave writes and corrupt the file.
+type jsonStore struct {
+	path string
+	mu   sync.Mutex // serializes access within this process; flock covers others
+}
+
+func newJSONStore(path string) *jsonStore {
+	return &jsonStore{path: path}
+}
+
+// withFile opens the data file, takes an exclusive flock for the duration
+// of fn, and passes it the current contents (with any legacy entries
+// missing a UID backfilled). If fn returns a non-nil slice, or the backfill
+// touched anything, the result is written back before the lock is released.
+func (s *jsonStore) withFile(fn func(todos []Todo) ([]Todo, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("flock %s: %w", s.path, err)
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	var todos []Todo
+	if err := json.NewDecoder(f).Decode(&todos); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	dirty := false
+	for i := range todos {
+		if todos[i].UID == "" {
+			todos[i].UID = newUID()
+			dirty = true
+		}
+	}
+
+	out, err := fn(todos)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		if !dirty {
+			return nil
+		}
+		out = todos
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	b, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	return err
+}
+
+func (s *jsonStore) Add(t Todo) (Todo, error) {
+	if t.UID == "" {
+		t.UID = newUID()
+	}
+	err := s.withFile(func(todos []Todo) ([]Todo, error) {
+		return append(todos, t), nil
+	})
+	return t, err
+}
+
+func (s *jsonStore) Update(match string, patch TodoPatch, ifMatch string) (int, error) {
+	var n int
+	err := s.withFile(func(todos []Todo) ([]Todo, error) {
+		if ifMatch != "" {
+			if current, ok := findFirstTodo(todos, match); ok && etagFor(current) != ifMatch {
+				return nil, errETagMismatch
+			}
+		}
+		out, updated := patchTodos(todos, match, patch)
+		n = updated
+		if updated == 0 {
+			return nil, nil
+		}
+		return out, nil
+	})
+	return n, err
+}
+
+func (s *jsonStore) Delete(summary string, ifMatch string) (int, error) {
+	var n int
+	err := s.withFile(func(todos []Todo) ([]Todo, error) {
+		if ifMatch != "" {
+			if current, ok := findFirstTodo(todos, summary); ok && etagFor(current) != ifMatch {
+				return nil, errETagMismatch
+			}
+		}
+		out, removed := deleteTodos(todos, summary)
+		n = removed
+		if removed == 0 {
+			return nil, nil
+		}
+		return out, nil
+	})
+	return n, err
+}
+
+func (s *jsonStore) List() ([]Todo, error) {
+	var out []Todo
+	err := s.withFile(func(todos []Todo) ([]Todo, error) {
+		out = todos
+		return nil, nil
+	})
+	return out, err
+}
+
+func (s *jsonStore) Get(summary string) (Todo, bool, error) {
+	var t Todo
+	var ok bool
+	err := s.withFile(func(todos []Todo) ([]Todo, error) {
+		t, ok = findFirstTodo(todos, summary)
+		return nil, nil
+	})
+	return t, ok, err
+}
+
+func (s *jsonStore) ReplaceAll(todos []Todo) error {
+	return s.withFile(func([]Todo) ([]Todo, error) {
+		return todos, nil
+	})
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// withStores runs fn against a fresh jsonStore and a fresh sqliteStore, so
+// Store-contract tests (CAS, basic CRUD) are checked against both backends
+// without duplicating the test body.
+func withStores(t *testing.T, fn func(t *testing.T, store Store)) {
+	t.Helper()
+
+	t.Run("json", func(t *testing.T) {
+		f, err := os.CreateTemp("", "gotodo-*.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		f.Close()
+		fn(t, newJSONStore(f.Name()))
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		f, err := os.CreateTemp("", "gotodo-*.db")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(f.Name())
+		f.Close()
+		store, err := newSQLiteStore(f.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn(t, store)
+	})
+}
+
+func TestStoreAddGetListDelete(t *testing.T) {
+	withStores(t, func(t *testing.T, store Store) {
+		added, err := store.Add(Todo{Summary: "buy milk", Priority: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added.UID == "" {
+			t.Fatal("Add did not assign a UID")
+		}
+
+		got, ok, err := store.Get("buy milk")
+		if err != nil || !ok {
+			t.Fatalf("Get: got=%v, ok=%v, err=%v", got, ok, err)
+		}
+		if got.Priority != 3 {
+			t.Errorf("Priority = %d, want 3", got.Priority)
+		}
+
+		all, err := store.List()
+		if err != nil || len(all) != 1 {
+			t.Fatalf("List: got %d todos, err=%v, want 1", len(all), err)
+		}
+
+		n, err := store.Delete("buy milk", "")
+		if err != nil || n != 1 {
+			t.Fatalf("Delete: n=%d, err=%v, want 1", n, err)
+		}
+
+		_, ok, err = store.Get("buy milk")
+		if err != nil || ok {
+			t.Fatalf("Get after delete: ok=%v, err=%v, want false", ok, err)
+		}
+	})
+}
+
+func TestStoreUpdateRejectsStaleIfMatch(t *testing.T) {
+	withStores(t, func(t *testing.T, store Store) {
+		added, err := store.Add(Todo{Summary: "buy milk"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stale := etagFor(added)
+
+		details := "2% please"
+		if _, err := store.Update("buy milk", TodoPatch{Details: &details}, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		other := "whole milk"
+		if _, err := store.Update("buy milk", TodoPatch{Details: &other}, stale); !errors.Is(err, errETagMismatch) {
+			t.Fatalf("Update with stale ifMatch: err=%v, want errETagMismatch", err)
+		}
+
+		got, _, err := store.Get("buy milk")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Details != details {
+			t.Errorf("Details = %q, want %q (stale update must not have applied)", got.Details, details)
+		}
+	})
+}
+
+func TestStoreUpdateAcceptsCurrentIfMatch(t *testing.T) {
+	withStores(t, func(t *testing.T, store Store) {
+		added, err := store.Add(Todo{Summary: "buy milk"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		current := etagFor(added)
+
+		details := "2% please"
+		n, err := store.Update("buy milk", TodoPatch{Details: &details}, current)
+		if err != nil || n != 1 {
+			t.Fatalf("Update with current ifMatch: n=%d, err=%v", n, err)
+		}
+	})
+}
+
+func TestStoreDeleteRejectsStaleIfMatch(t *testing.T) {
+	withStores(t, func(t *testing.T, store Store) {
+		added, err := store.Add(Todo{Summary: "buy milk"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stale := etagFor(added)
+
+		details := "2% please"
+		if _, err := store.Update("buy milk", TodoPatch{Details: &details}, ""); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.Delete("buy milk", stale); !errors.Is(err, errETagMismatch) {
+			t.Fatalf("Delete with stale ifMatch: err=%v, want errETagMismatch", err)
+		}
+
+		if _, ok, err := store.Get("buy milk"); err != nil || !ok {
+			t.Fatalf("todo should survive a rejected delete: ok=%v, err=%v", ok, err)
+		}
+	})
+}
+
+// TestJSONStoreWithFileSerializesConcurrentWrites exercises the flock-guarded
+// critical section in jsonStore.withFile: many goroutines each add one todo
+// concurrently, and every addition must survive (no lost update from two
+// writers racing on the same read-modify-write cycle).
+func TestJSONStoreWithFileSerializesConcurrentWrites(t *testing.T) {
+	f, err := os.CreateTemp("", "gotodo-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	store := newJSONStore(f.Name())
+
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := store.Add(Todo{Summary: fmt.Sprintf("task-%d", i)})
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	todos, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != n {
+		t.Fatalf("len(todos) = %d, want %d (concurrent Add calls must not lose writes)", len(todos), n)
+	}
+}
+
+func TestUpdateDoneOnRecurringSeriesTargetsPendingRowOnly(t *testing.T) {
+	f, err := os.CreateTemp("", "gotodo-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+
+	store := newJSONStore(f.Name())
+	_, err = store.Add(Todo{
+		Summary:  "water plants",
+		RRule:    "FREQ=DAILY",
+		Deadline: time.Now().Round(24 * time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := true
+	patch := TodoPatch{Done: &done}
+
+	if n, err := store.Update("water plants", patch, ""); err != nil || n != 1 {
+		t.Fatalf("first complete: n=%d, err=%v, want n=1", n, err)
+	}
+
+	// A second completion should only touch the newly spawned pending row,
+	// not reopen the archived completed one.
+	if n, err := store.Update("water plants", patch, ""); err != nil || n != 1 {
+		t.Fatalf("second complete: n=%d, err=%v, want n=1", n, err)
+	}
+
+	todos, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 3 {
+		t.Fatalf("len(todos) = %d, want 3 (two done instances, one pending)", len(todos))
+	}
+
+	doneCount, pendingCount := 0, 0
+	for _, todo := range todos {
+		if todo.Done {
+			doneCount++
+		} else {
+			pendingCount++
+		}
+	}
+	if doneCount != 2 || pendingCount != 1 {
+		t.Fatalf("got %d done / %d pending, want 2 done / 1 pending", doneCount, pendingCount)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Event is broadcast over /ws whenever addTodoOperation, setTodoOperation or
+// deleteTodoOperation mutates the list, so open index.html tabs can refresh
+// themselves instead of relying on the old form-redirect round-trip.
+type Event struct {
+	Type    string `json:"type"` // "created", "updated" or "deleted"
+	Summary string `json:"summary"`
+}
+
+// broadcaster fans a Publish out to every subscribed /ws connection. Each
+// subscriber gets its own buffered channel so one slow client can't block
+// delivery to the others; a full channel just drops the event, and the
+// client picks up the change on its next fetch anyway.
+type broadcaster struct {
+	subs sync.Map // map[<-chan Event]chan Event
+}
+
+var hub = &broadcaster{}
+
+// Subscribe registers a new listener and returns its event channel.
+func (b *broadcaster) Subscribe() <-chan Event {
+	ch := make(chan Event, 8)
+	var key <-chan Event = ch
+	b.subs.Store(key, ch)
+	return key
+}
+
+// Unsubscribe removes and closes a channel returned by Subscribe.
+func (b *broadcaster) Unsubscribe(ch <-chan Event) {
+	if v, ok := b.subs.LoadAndDelete(ch); ok {
+		close(v.(chan Event))
+	}
+}
+
+// Publish sends e to every current subscriber without blocking.
+func (b *broadcaster) Publish(e Event) {
+	b.subs.Range(func(_, v any) bool {
+		select {
+		case v.(chan Event) <- e:
+		default:
+		}
+		return true
+	})
+}
+
+// Close disconnects every current subscriber; used during graceful shutdown.
+func (b *broadcaster) Close() {
+	b.subs.Range(func(k, v any) bool {
+		b.subs.Delete(k)
+		close(v.(chan Event))
+		return true
+	})
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+const (
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = wsPingInterval + 10*time.Second
+)
+
+// wsHandler upgrades the request to a WebSocket and streams Events to it
+// until the client disconnects or hub.Close runs at shutdown. A 30s ping is
+// used to detect dead connections.
+func wsHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println("ws upgrade:", err)
+		return
+	}
+	defer conn.Close()
+
+	events := hub.Subscribe()
+	defer hub.Unsubscribe(events)
+
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		return nil
+	})
+
+	// The client never sends anything meaningful, but we still need to pump
+	// reads so control frames (pong, close) are processed.
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBroadcasterFansOutToAllSubscribers(t *testing.T) {
+	b := &broadcaster{}
+	a := b.Subscribe()
+	c := b.Subscribe()
+
+	b.Publish(Event{Type: "created", Summary: "x"})
+
+	for _, ch := range []<-chan Event{a, c} {
+		select {
+		case e := <-ch:
+			if e.Type != "created" || e.Summary != "x" {
+				t.Errorf("got %+v, want {created x}", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func TestBroadcasterUnsubscribeStopsDelivery(t *testing.T) {
+	b := &broadcaster{}
+	ch := b.Subscribe()
+	b.Unsubscribe(ch)
+
+	b.Publish(Event{Type: "deleted", Summary: "y"})
+
+	select {
+	case e, ok := <-ch:
+		if ok {
+			t.Fatalf("unsubscribed channel received %+v", e)
+		}
+		// ok == false: the channel was closed by Unsubscribe, as expected.
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("unsubscribed channel was neither closed nor drained")
+	}
+}
+
+func TestBroadcasterPublishDoesNotBlockOnFullSubscriber(t *testing.T) {
+	b := &broadcaster{}
+	ch := b.Subscribe()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			b.Publish(Event{Type: "updated", Summary: "z"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a subscriber whose buffer filled up")
+	}
+
+	// Drain whatever made it through; a full buffered channel just drops
+	// the rest rather than blocking the publisher.
+	for {
+		select {
+		case <-ch:
+		default:
+			return
+		}
+	}
+}
+
+func TestBroadcasterCloseDisconnectsEverySubscriber(t *testing.T) {
+	b := &broadcaster{}
+	a := b.Subscribe()
+	c := b.Subscribe()
+
+	b.Close()
+
+	for _, ch := range []<-chan Event{a, c} {
+		select {
+		case _, ok := <-ch:
+			if ok {
+				t.Fatal("expected channel to be closed")
+			}
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("channel was not closed by hub.Close")
+		}
+	}
+}